@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"go.uber.org/zap"
+)
+
+// UserContext is the authenticated identity attached to a request or
+// WebSocket connection once its JWT has been validated.
+type UserContext struct {
+	Subject string
+	Name    string
+}
+
+type authCtxKey struct{}
+
+func withUserContext(r *http.Request, u UserContext) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), authCtxKey{}, u))
+}
+
+func userFromContext(ctx context.Context) (UserContext, bool) {
+	u, ok := ctx.Value(authCtxKey{}).(UserContext)
+	return u, ok
+}
+
+// jwtVerifier validates tokens against whichever key material JWT_SECRET
+// (HS256) and/or JWT_PUBLIC_KEY (RS256, PEM-encoded) configured at startup.
+type jwtVerifier struct {
+	secret    []byte
+	publicKey *rsa.PublicKey
+}
+
+func newJWTVerifier() (*jwtVerifier, error) {
+	v := &jwtVerifier{}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		v.secret = []byte(secret)
+	}
+	if pubPEM := os.Getenv("JWT_PUBLIC_KEY"); pubPEM != "" {
+		key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pubPEM))
+		if err != nil {
+			return nil, fmt.Errorf("parse JWT_PUBLIC_KEY: %w", err)
+		}
+		v.publicKey = key
+	}
+	if v.secret == nil && v.publicKey == nil {
+		return nil, errors.New("neither JWT_SECRET nor JWT_PUBLIC_KEY is configured")
+	}
+	return v, nil
+}
+
+// parse validates tokenStr's signature and expiry and derives a UserContext
+// from its claims. The "name" claim is used as the display name, falling
+// back to the subject when absent.
+func (v *jwtVerifier) parse(tokenStr string) (UserContext, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(t *jwt.Token) (interface{}, error) {
+		switch t.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if v.secret == nil {
+				return nil, errors.New("HS256 token presented but JWT_SECRET is not configured")
+			}
+			return v.secret, nil
+		case *jwt.SigningMethodRSA:
+			if v.publicKey == nil {
+				return nil, errors.New("RS256 token presented but JWT_PUBLIC_KEY is not configured")
+			}
+			return v.publicKey, nil
+		default:
+			return nil, fmt.Errorf("unsupported signing method: %v", t.Method.Alg())
+		}
+	})
+	if err != nil {
+		return UserContext{}, err
+	}
+
+	sub, _ := claims.GetSubject()
+	name, _ := claims["name"].(string)
+	if name == "" {
+		name = sub
+	}
+	return UserContext{Subject: sub, Name: name}, nil
+}
+
+// jwtAuthMiddleware requires a valid `Authorization: Bearer <token>` header
+// on /api/* requests, rejecting unsigned/expired/malformed tokens with 401.
+func jwtAuthMiddleware(v *jwtVerifier, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := loggerFromContext(r.Context())
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			l.Warn("api request rejected: missing bearer token")
+			http.Error(w, "missing bearer token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := v.parse(token)
+		if err != nil {
+			l.Warn("api request rejected: invalid token", zap.Error(err))
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, withUserContext(r, user))
+	})
+}
+
+// wsRequestedSubprotocol returns the first Sec-WebSocket-Protocol value the
+// client offered, or "" if it didn't send one. Used both to recover the
+// token (wsTokenFromRequest) and, on a successful upgrade, to echo the same
+// value back so the handshake completes for clients that negotiated it
+// (e.g. browsers calling new WebSocket(url, [token])).
+func wsRequestedSubprotocol(r *http.Request) string {
+	proto := r.Header.Get("Sec-WebSocket-Protocol")
+	if proto == "" {
+		return ""
+	}
+	return strings.TrimSpace(strings.Split(proto, ",")[0])
+}
+
+// wsTokenFromRequest extracts the bearer token for a WebSocket upgrade.
+// Browsers can't set arbitrary headers on the WS handshake, so the token
+// travels either as the Sec-WebSocket-Protocol subprotocol or a ?token=
+// query param, in that order of preference.
+func wsTokenFromRequest(r *http.Request) string {
+	if proto := wsRequestedSubprotocol(r); proto != "" {
+		return proto
+	}
+	return r.URL.Query().Get("token")
+}
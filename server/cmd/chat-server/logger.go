@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// initLogger builds the package-level *zap.Logger from env config.
+//
+// LOG_LEVEL controls verbosity (debug|info|warn|error, default info) and
+// LOG_FORMAT selects the encoding (json|console, default json). JSON is the
+// right default for shipping to Loki/ELK; console is handy for local dev.
+func initLogger() *zap.Logger {
+	level := zapcore.InfoLevel
+	if err := level.UnmarshalText([]byte(os.Getenv("LOG_LEVEL"))); err != nil {
+		level = zapcore.InfoLevel
+	}
+
+	encoderCfg := zap.NewProductionEncoderConfig()
+	encoderCfg.TimeKey = "ts"
+	encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	var encoder zapcore.Encoder
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "console" {
+		encoder = zapcore.NewConsoleEncoder(encoderCfg)
+	} else {
+		encoder = zapcore.NewJSONEncoder(encoderCfg)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.Lock(os.Stdout), level)
+	return zap.New(core, zap.AddCaller())
+}
+
+type loggerCtxKey struct{}
+
+// withRequestLogger attaches a request-scoped logger to r's context so
+// downstream handlers can pull it out with loggerFromContext.
+func withRequestLogger(r *http.Request, l *zap.Logger) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), loggerCtxKey{}, l))
+}
+
+// loggerFromContext returns the request-scoped logger, falling back to the
+// package-level logger if none was attached (e.g. in tests).
+func loggerFromContext(ctx context.Context) *zap.Logger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(*zap.Logger); ok {
+		return l
+	}
+	return logger
+}
@@ -6,18 +6,22 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"log"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
 	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
 )
 
 // config.go
@@ -29,34 +33,76 @@ type Config struct {
 
 var config Config
 
+// logger is the package-level structured logger, initialized in main() from
+// LOG_LEVEL/LOG_FORMAT. Code that only has access to a request or client
+// should prefer the scoped logger attached to that request/client instead.
+var logger *zap.Logger
+
 // ---------------- DB Setup ----------------
 
 var db *pgxpool.Pool
 
+// defaultRoom is used when a client or API caller doesn't specify one.
+const defaultRoom = "general"
+
 type Message struct {
 	ID        int       `json:"id,omitempty"`
+	Room      string    `json:"room"`
 	Name      string    `json:"name"` // NEW: username or display name
 	Content   string    `json:"content"`
 	Timestamp time.Time `json:"timestamp"`
 }
 
-func saveMessage(msg Message) {
-	_, err := db.Exec(context.Background(),
-		"INSERT INTO messages (name, content, timestamp) VALUES ($1, $2, $3)",
-		msg.Name, msg.Content, msg.Timestamp,
-	)
+// ensureRoomID upserts a room by name and returns its id, creating the row
+// on first use so callers never have to pre-provision rooms.
+func ensureRoomID(name string) (int, error) {
+	defer observeDBQuery("ensure_room", time.Now())
+
+	var id int
+	err := db.QueryRow(context.Background(), `
+		INSERT INTO rooms (name) VALUES ($1)
+		ON CONFLICT (name) DO UPDATE SET name = EXCLUDED.name
+		RETURNING id
+		`, name).Scan(&id)
+	return id, err
+}
+
+// saveMessage persists a chat message and returns its server-assigned ID so
+// the caller can echo it back to the sender for dedupe/ack.
+func saveMessage(msg Message, l *zap.Logger) (int, error) {
+	defer observeDBQuery("save_message", time.Now())
+
+	roomID, err := ensureRoomID(msg.Room)
 	if err != nil {
-		log.Println("DB insert error:", err)
+		l.Error("resolve room failed", zap.Error(err), zap.String("room", msg.Room))
+		return 0, err
 	}
+
+	var id int
+	err = db.QueryRow(context.Background(),
+		"INSERT INTO messages (room_id, name, content, timestamp) VALUES ($1, $2, $3, $4) RETURNING id",
+		roomID, msg.Name, msg.Content, msg.Timestamp,
+	).Scan(&id)
+	if err != nil {
+		l.Error("db insert failed", zap.Error(err), zap.Int("msg_bytes", len(msg.Content)))
+		return 0, err
+	}
+	return id, nil
 }
 
-func getRecentMessages(limit int) ([]Message, error) {
+// getMessages returns up to limit messages from room older than before,
+// newest first, for cursor-style pagination (?before=<timestamp>&limit=).
+func getMessages(room string, before time.Time, limit int) ([]Message, error) {
+	defer observeDBQuery("get_messages", time.Now())
+
 	rows, err := db.Query(context.Background(), `
-		SELECT id, name, content, timestamp
-        FROM messages
-        ORDER BY timestamp DESC
-        LIMIT $1
-		`, limit)
+		SELECT m.id, r.name, m.name, m.content, m.timestamp
+        FROM messages m
+        JOIN rooms r ON r.id = m.room_id
+        WHERE r.name = $1 AND m.timestamp < $2
+        ORDER BY m.timestamp DESC
+        LIMIT $3
+		`, room, before, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -65,7 +111,7 @@ func getRecentMessages(limit int) ([]Message, error) {
 	var messages []Message
 	for rows.Next() {
 		var msg Message
-		if err := rows.Scan(&msg.ID, &msg.Name, &msg.Content, &msg.Timestamp); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.Room, &msg.Name, &msg.Content, &msg.Timestamp); err != nil {
 			continue
 		}
 		messages = append(messages, msg)
@@ -73,7 +119,9 @@ func getRecentMessages(limit int) ([]Message, error) {
 	return messages, nil
 }
 
-// Helper to get real client IP from a request
+// getRealIP returns the caller's bare IP (no port), so it can be used as a
+// stable rate-limit/connection-cap key. It prefers X-Forwarded-For, falling
+// back to RemoteAddr for non-proxied deployments.
 func getRealIP(r *http.Request) string {
 	xff := r.Header.Get("X-Forwarded-For")
 	if xff != "" {
@@ -81,35 +129,114 @@ func getRealIP(r *http.Request) string {
 		ips := strings.Split(xff, ",")
 		return strings.TrimSpace(ips[0])
 	}
-	// fallback to remote addr (includes port)
+	// RemoteAddr is host:port; strip the port so per-connection values
+	// don't defeat per-IP limiting.
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
 	return r.RemoteAddr
 }
 
 // ---------------- WebSocket ----------------
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool { return true },
+	CheckOrigin: func(r *http.Request) bool {
+		if config.AllowedOrigin == "" || config.AllowedOrigin == "*" {
+			return true
+		}
+		return r.Header.Get("Origin") == config.AllowedOrigin
+	},
 }
 
+var clientSeq uint64
+
 type Client struct {
-	conn *websocket.Conn
-	send chan []byte
+	id          string
+	room        string
+	name        string
+	ip          string
+	conn        *websocket.Conn
+	send        chan []byte
+	sendMu      sync.Mutex // guards sendClosed; see trySend/closeSend
+	sendClosed  bool
+	logger      *zap.Logger
+	msgLimiter  *IPRateLimiter // nil disables per-message rate limiting (e.g. in tests)
+	maxMsgBytes int64
+	release     func() // frees this client's per-IP connection slot; nil if none held
+}
+
+// trySend enqueues data on c.send, returning false if the channel is full or
+// has already been closed. The hub (deliverLocal, unregister, Shutdown) can
+// close send concurrently with a readPump goroutine trying to write to it
+// (e.g. via sendRateLimited); serializing both through sendMu is what makes
+// that safe instead of relying on send never being written to after close.
+func (c *Client) trySend(data []byte) bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return false
+	}
+	select {
+	case c.send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// closeSend closes c.send exactly once, safe to call concurrently with
+// trySend. It reports whether this call performed the close, so callers can
+// tell a fresh close (which owns any accompanying bookkeeping) from a no-op.
+func (c *Client) closeSend() bool {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	if c.sendClosed {
+		return false
+	}
+	c.sendClosed = true
+	close(c.send)
+	return true
+}
+
+// roomMessage is an encoded envelope scoped to a single room; the Hub only
+// fans it out to clients registered in that room.
+type roomMessage struct {
+	room string
+	data []byte
+}
+
+// RoomInfo is the /api/rooms view of a room's live membership.
+type RoomInfo struct {
+	Name    string `json:"name"`
+	Members int    `json:"members"`
+}
+
+// Presence tracks a connected client's announced name and last activity
+// within a room. It's ephemeral and never persisted.
+type Presence struct {
+	Name     string
+	LastSeen time.Time
 }
 
 type Hub struct {
-	clients    map[*Client]bool
-	mu         sync.Mutex // Add this line
-	broadcast  chan []byte
+	mu         sync.Mutex
+	clients    map[string]map[*Client]*Presence
+	broadcast  chan roomMessage
+	inbound    chan roomMessage // messages relayed in from other instances via Redis
 	register   chan *Client
 	unregister chan *Client
+	heartbeat  chan chan struct{} // liveness probe for /readyz, see Alive
+	redis      *redis.Client      // nil unless REDIS_URL is set; see redis.go
 }
 
 func newHub() *Hub {
 	return &Hub{
-		clients:    make(map[*Client]bool),
-		broadcast:  make(chan []byte),
+		clients:    make(map[string]map[*Client]*Presence),
+		broadcast:  make(chan roomMessage),
+		inbound:    make(chan roomMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
+		heartbeat:  make(chan chan struct{}),
 	}
 }
 
@@ -117,32 +244,139 @@ func (h *Hub) run() {
 	for {
 		select {
 		case client := <-h.register:
-			h.clients[client] = true
-		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			h.mu.Lock()
+			if h.clients[client.room] == nil {
+				h.clients[client.room] = make(map[*Client]*Presence)
 			}
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			h.clients[client.room][client] = &Presence{Name: client.name, LastSeen: time.Now().UTC()}
+			h.mu.Unlock()
+			activeConnections.Inc()
+		case client := <-h.unregister:
+			h.mu.Lock()
+			if clients, ok := h.clients[client.room]; ok {
+				if _, ok := clients[client]; ok {
+					delete(clients, client)
+					client.closeSend()
+					if len(clients) == 0 {
+						delete(h.clients, client.room)
+					}
+					activeConnections.Dec()
 				}
 			}
+			h.mu.Unlock()
+		case msg := <-h.broadcast:
+			h.deliverLocal(msg)
+			h.publishRedis(msg, logger)
+		case msg := <-h.inbound:
+			h.deliverLocal(msg)
+		case ping := <-h.heartbeat:
+			close(ping)
+		}
+	}
+}
+
+// deliverLocal fans msg out to clients connected to this instance only.
+func (h *Hub) deliverLocal(msg roomMessage) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for client := range h.clients[msg.room] {
+		if client.trySend(msg.data) {
+			messagesSentTotal.Inc()
+			continue
+		}
+		// Buffer full: the client can't keep up. Evict it the same way
+		// unregister would, including the connection-count bookkeeping,
+		// since readPump's own unregister will no-op once this delete
+		// has already removed it from h.clients.
+		delete(h.clients[msg.room], client)
+		if len(h.clients[msg.room]) == 0 {
+			delete(h.clients, msg.room)
+		}
+		if client.closeSend() {
+			activeConnections.Dec()
 		}
 	}
 }
 
+// Alive round-trips a no-op through the run loop with ctx's deadline, so
+// /readyz can detect a wedged or dead hub goroutine.
+func (h *Hub) Alive(ctx context.Context) bool {
+	ping := make(chan struct{})
+	select {
+	case h.heartbeat <- ping:
+	case <-ctx.Done():
+		return false
+	}
+	select {
+	case <-ping:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// Rooms returns a snapshot of currently active rooms and their member counts.
+func (h *Hub) Rooms() []RoomInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rooms := make([]RoomInfo, 0, len(h.clients))
+	for room, clients := range h.clients {
+		rooms = append(rooms, RoomInfo{Name: room, Members: len(clients)})
+	}
+	return rooms
+}
+
+// Touch updates a client's presence (name, if non-empty, and last-seen time).
+func (h *Hub) Touch(client *Client, name string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	p, ok := h.clients[client.room][client]
+	if !ok {
+		return
+	}
+	if name != "" {
+		p.Name = name
+	}
+	p.LastSeen = time.Now().UTC()
+}
+
+// Roster returns the current presence list for room.
+func (h *Hub) Roster(room string) []PresenceEvent {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	roster := make([]PresenceEvent, 0, len(h.clients[room]))
+	for client, p := range h.clients[room] {
+		roster = append(roster, PresenceEvent{ClientID: client.id, Name: p.Name, LastSeen: p.LastSeen})
+	}
+	return roster
+}
+
+// broadcastPresence emits a join/leave/typing event to c's room. These
+// events are ephemeral: they're fanned out like any other envelope but
+// never touch Postgres.
+func (h *Hub) broadcastPresence(eventType string, c *Client) {
+	data, err := encodeEnvelope(eventType, PresenceEvent{ClientID: c.id, Name: c.name, LastSeen: time.Now().UTC()})
+	if err != nil {
+		c.logger.Error("encode presence event failed", zap.Error(err))
+		return
+	}
+	h.broadcast <- roomMessage{room: c.room, data: data}
+}
+
 func (c *Client) readPump(h *Hub) {
 	defer func() {
+		h.broadcastPresence(EnvelopeLeave, c)
 		h.unregister <- c
 		c.conn.Close()
+		if c.release != nil {
+			c.release()
+		}
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(c.maxMsgBytes)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second)) // extend deadline
@@ -152,21 +386,65 @@ func (c *Client) readPump(h *Hub) {
 	for {
 		_, rawMsg, err := c.conn.ReadMessage()
 		if err != nil {
-			log.Println("read error:", err)
+			c.logger.Info("read error", zap.Error(err))
 			break
 		}
 
-		var msg Message
-		if err := json.Unmarshal(rawMsg, &msg); err != nil {
-			log.Println("invalid message format:", err)
+		if c.msgLimiter != nil && !c.msgLimiter.Allow(c.ip) {
+			c.logger.Warn("ws message rate limited")
+			c.sendRateLimited(wsRateLimitRetryAfter)
 			continue
 		}
-		msg.Timestamp = time.Now().UTC()
-		go saveMessage(msg)
 
-		encoded, _ := json.Marshal(msg)
-		h.broadcast <- encoded
+		var env Envelope
+		if err := json.Unmarshal(rawMsg, &env); err != nil {
+			c.logger.Warn("invalid envelope", zap.Error(err))
+			continue
+		}
+
+		switch env.Type {
+		case EnvelopeChat:
+			c.handleChat(h, env.Payload)
+		case EnvelopeJoin:
+			h.Touch(c, c.name)
+			h.broadcastPresence(EnvelopeJoin, c)
+		case EnvelopeTyping:
+			h.Touch(c, "")
+			h.broadcastPresence(EnvelopeTyping, c)
+		default:
+			c.logger.Warn("unknown envelope type", zap.String("type", env.Type))
+		}
+	}
+}
+
+// handleChat persists a chat message, assigns it a server-authoritative ID,
+// and broadcasts it (with that ID) so clients can dedupe/ack.
+func (c *Client) handleChat(h *Hub, payload json.RawMessage) {
+	var msg Message
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		c.logger.Warn("invalid chat payload", zap.Error(err))
+		return
+	}
+	msg.Name = c.name // server-authoritative: from the validated JWT, never the client body
+	msg.Room = c.room // server-authoritative: ignore any room the client tries to set
+	msg.Timestamp = time.Now().UTC()
+	messagesReceivedTotal.Inc()
+
+	id, err := saveMessage(msg, c.logger)
+	if err != nil {
+		return
+	}
+	msg.ID = id
+	h.Touch(c, "")
+
+	encoded, err := encodeEnvelope(EnvelopeChat, msg)
+	if err != nil {
+		c.logger.Error("encode chat envelope failed", zap.Error(err))
+		return
 	}
+	h.broadcast <- roomMessage{room: c.room, data: encoded}
+
+	c.logger.Debug("message broadcast", zap.Int("id", id), zap.String("name", msg.Name), zap.Int("msg_bytes", len(msg.Content)))
 }
 
 func (c *Client) writePump() {
@@ -187,28 +465,64 @@ func (c *Client) writePump() {
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			err := c.conn.WriteMessage(websocket.TextMessage, msg)
 			if err != nil {
-				log.Println("write error:", err)
+				c.logger.Info("write error", zap.Error(err))
 				return
 			}
 		case <-ticker.C:
 			// Send Ping
 			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
 			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Println("ping error:", err)
+				c.logger.Info("ping error", zap.Error(err))
 				return
 			}
 		}
 	}
 }
 
-func serveWs(h *Hub, w http.ResponseWriter, r *http.Request) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+func serveWs(h *Hub, connLimiter *ConnLimiter, msgLimiter *IPRateLimiter, rlCfg RateLimitConfig, w http.ResponseWriter, r *http.Request) {
+	l := loggerFromContext(r.Context())
+
+	user, _ := userFromContext(r.Context()) // always present: wsAuthMiddleware rejects otherwise
+
+	room := strings.TrimSpace(r.URL.Query().Get("room"))
+	if room == "" {
+		room = defaultRoom
+	}
+
+	ip := getRealIP(r)
+	if !connLimiter.Acquire(ip) {
+		l.Warn("websocket connection rejected: per-IP connection cap reached", zap.String("remote_ip", ip))
+		http.Error(w, "too many connections from this IP", http.StatusTooManyRequests)
+		return
+	}
+
+	var respHeader http.Header
+	if proto := wsRequestedSubprotocol(r); proto != "" {
+		respHeader = http.Header{"Sec-WebSocket-Protocol": {proto}}
+	}
+
+	conn, err := upgrader.Upgrade(w, r, respHeader)
 	if err != nil {
-		log.Println("upgrade error:", err)
+		connLimiter.Release(ip)
+		l.Error("upgrade failed", zap.Error(err), zap.String("remote_ip", ip))
 		return
 	}
-	client := &Client{conn: conn, send: make(chan []byte, 256)}
+
+	id := fmt.Sprintf("c%d", atomic.AddUint64(&clientSeq, 1))
+	client := &Client{
+		id:          id,
+		room:        room,
+		name:        user.Name,
+		ip:          ip,
+		conn:        conn,
+		send:        make(chan []byte, 256),
+		logger:      l.With(zap.String("client_id", id), zap.String("remote_ip", ip), zap.String("room", room), zap.String("subject", user.Subject)),
+		msgLimiter:  msgLimiter,
+		maxMsgBytes: rlCfg.MaxMsgBytes,
+		release:     func() { connLimiter.Release(ip) },
+	}
 	h.register <- client
+	client.logger.Info("client connected")
 
 	go client.writePump()
 	client.readPump(h)
@@ -218,30 +532,39 @@ func serveWs(h *Hub, w http.ResponseWriter, r *http.Request) {
 
 // ----------------HTTP Middleware -----------
 
-// loggingMiddleware logs incoming HTTP requests and the time taken to process them
+// loggingMiddleware attaches a per-request logger to the request context and
+// emits a single structured entry once the request has been handled.
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
+		reqLogger := logger.With(
+			zap.String("remote_ip", getRealIP(r)),
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.Path),
+		)
+
 		// Wrap ResponseWriter to capture status code and response body
 		lrw := &loggingResponseWriter{
 			ResponseWriter: w,
 			statusCode:     http.StatusOK,
 			body:           &bytes.Buffer{},
 		}
-		next.ServeHTTP(lrw, r)
+		next.ServeHTTP(lrw, withRequestLogger(r, reqLogger))
 
 		duration := time.Since(start)
+		observeHTTPRequest(r.URL.Path, r.Method, lrw.statusCode, duration)
 
-		// Log the request with basic info
-		logMsg := fmt.Sprintf("%s %s %s %d %s", getRealIP(r), r.Method, r.URL.Path, lrw.statusCode, duration)
-
-		// If there's an error status code, also log the response body
+		fields := []zap.Field{
+			zap.Int("status", lrw.statusCode),
+			zap.Int64("duration_ms", duration.Milliseconds()),
+		}
 		if lrw.statusCode >= 400 {
-			logMsg += fmt.Sprintf(" - Error: %s", lrw.body.String())
+			fields = append(fields, zap.String("error", lrw.body.String()))
+			reqLogger.Warn("request completed", fields...)
+			return
 		}
-
-		log.Printf(logMsg)
+		reqLogger.Info("request completed", fields...)
 	})
 }
 
@@ -276,10 +599,39 @@ func (lrw *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error)
 
 // Enhanced error handling in your handlers (RECOMMENDED APPROACH)
 func handleGetMessages(w http.ResponseWriter, r *http.Request) {
-	messages, err := getRecentMessages(100)
+	l := loggerFromContext(r.Context())
+
+	room := strings.TrimSpace(r.URL.Query().Get("room"))
+	if room == "" {
+		room = defaultRoom
+	}
+
+	before := time.Now().UTC()
+	if raw := r.URL.Query().Get("before"); raw != "" {
+		parsed, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			http.Error(w, "Invalid before timestamp, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+		before = parsed
+	}
+
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit, expected a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > 200 {
+		limit = 200
+	}
+
+	messages, err := getMessages(room, before, limit)
 	if err != nil {
-		// Log the actual error details with context
-		log.Printf("ERROR in handleGetMessages - getRecentMessages failed: %v", err)
+		l.Error("getMessages failed", zap.Error(err), zap.String("room", room))
 
 		// Return error to client
 		http.Error(w, "Failed to get messages", http.StatusInternalServerError)
@@ -288,16 +640,63 @@ func handleGetMessages(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(messages); err != nil {
-		log.Printf("ERROR in handleGetMessages - JSON encoding failed: %v", err)
+		l.Error("json encoding failed", zap.Error(err))
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 		return
 	}
 }
 
-func wsAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
+// handleGetRooms lists rooms that currently have connected clients.
+func handleGetRooms(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(h.Rooms()); err != nil {
+			loggerFromContext(r.Context()).Error("json encoding failed", zap.Error(err))
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// handleGetPresence returns the current roster for ?room= (defaultRoom if
+// unset).
+func handleGetPresence(h *Hub) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("WebSocket connection from %s", getRealIP(r))
-		next(w, r)
+		room := strings.TrimSpace(r.URL.Query().Get("room"))
+		if room == "" {
+			room = defaultRoom
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(h.Roster(room)); err != nil {
+			loggerFromContext(r.Context()).Error("json encoding failed", zap.Error(err))
+			http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		}
+	}
+}
+
+// wsAuthMiddleware validates the JWT carried on a WebSocket upgrade request
+// (see wsTokenFromRequest for where browsers can smuggle it) before letting
+// the upgrade proceed, rejecting unsigned/expired tokens with 401.
+func wsAuthMiddleware(v *jwtVerifier, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		l := loggerFromContext(r.Context())
+
+		token := wsTokenFromRequest(r)
+		if token == "" {
+			l.Warn("websocket connection rejected: missing token")
+			http.Error(w, "missing token", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := v.parse(token)
+		if err != nil {
+			l.Warn("websocket connection rejected: invalid token", zap.Error(err))
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		l.Info("websocket connection accepted", zap.String("subject", user.Subject))
+		next(w, withUserContext(r, user))
 	}
 }
 
@@ -318,8 +717,10 @@ func (h *Hub) Shutdown() {
 	// Your logic to close all connections, e.g.
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	for c := range h.clients {
-		close(c.send) // or whatever method closes your client socket
+	for _, clients := range h.clients {
+		for c := range clients {
+			c.closeSend()
+		}
 	}
 }
 
@@ -329,6 +730,9 @@ func main() {
 
 	var err error
 
+	logger = initLogger()
+	defer logger.Sync()
+
 	// Populate config
 	config = Config{
 		DBUrl:         os.Getenv("DATABASE_URL"),
@@ -340,23 +744,52 @@ func main() {
 		config.Port = "8080" // default fallback
 	}
 
+	verifier, err := newJWTVerifier()
+	if err != nil {
+		logger.Fatal("jwt verifier setup failed", zap.Error(err))
+	}
+
+	rlCfg := loadRateLimitConfig()
+	connLimiter := newConnLimiter(rlCfg.ConnPerIP)
+	wsMsgLimiter := newIPRateLimiter(rlCfg.MsgPerSec, rlCfg.Burst, ipLimiterTTL)
+	restLimiter := newIPRateLimiter(rlCfg.MsgPerSec, rlCfg.Burst, ipLimiterTTL)
+
 	// Connect to DB
 	db, err = pgxpool.New(context.Background(), config.DBUrl)
 	if err != nil {
-		log.Fatal("DB connection failed:", err)
+		logger.Fatal("db connection failed", zap.Error(err))
 	}
 
 	// defer func() {
-	// 	log.Println("closing db connection ...")
+	// 	logger.Info("closing db connection ...")
 	// 	db.Close()
 	// }()
 
 	// Test the connection
 	if err := db.Ping(context.Background()); err != nil {
-		log.Fatal("DB connection test failed:", err)
+		logger.Fatal("db connection test failed", zap.Error(err))
+	}
+
+	// Ensure schema exists: rooms table plus messages.room_id FK, migrating
+	// forward from the pre-rooms schema when needed.
+	_, err = db.Exec(context.Background(), `
+		CREATE TABLE IF NOT EXISTS rooms (
+			id   SERIAL PRIMARY KEY,
+			name TEXT UNIQUE NOT NULL
+		)
+	`)
+	if err != nil {
+		logger.Fatal("failed to create rooms table", zap.Error(err))
+	}
+
+	_, err = db.Exec(context.Background(), `
+		INSERT INTO rooms (name) VALUES ($1)
+		ON CONFLICT (name) DO NOTHING
+	`, defaultRoom)
+	if err != nil {
+		logger.Fatal("failed to seed default room", zap.Error(err))
 	}
 
-	// Ensure table exists
 	_, err = db.Exec(context.Background(), `
 		CREATE TABLE IF NOT EXISTS messages (
 			id SERIAL PRIMARY KEY,
@@ -366,11 +799,34 @@ func main() {
 		)
 	`)
 	if err != nil {
-		log.Fatal("Failed to create messages table:", err)
+		logger.Fatal("failed to create messages table", zap.Error(err))
+	}
+
+	_, err = db.Exec(context.Background(), `
+		ALTER TABLE messages ADD COLUMN IF NOT EXISTS room_id INTEGER REFERENCES rooms(id)
+	`)
+	if err != nil {
+		logger.Fatal("failed to add messages.room_id", zap.Error(err))
+	}
+
+	_, err = db.Exec(context.Background(), `
+		UPDATE messages SET room_id = (SELECT id FROM rooms WHERE name = $1) WHERE room_id IS NULL
+	`, defaultRoom)
+	if err != nil {
+		logger.Fatal("failed to backfill messages.room_id", zap.Error(err))
 	}
 
 	// Set up hub
 	hub := newHub()
+	if redisURL := os.Getenv("REDIS_URL"); redisURL != "" {
+		cleanup, err := hub.EnableRedis(redisURL, logger)
+		if err != nil {
+			logger.Warn("redis unavailable, falling back to in-process broadcast only", zap.Error(err))
+		} else {
+			logger.Info("redis backplane enabled", zap.String("node_id", nodeID))
+			defer cleanup()
+		}
+	}
 	go hub.run()
 
 	// Set up HTTP server
@@ -385,35 +841,40 @@ func main() {
 	// Defer all cleanup in one function
 	defer func() {
 		if r := recover(); r != nil {
-			log.Printf("Panic during shutdown: %v", r)
+			logger.Error("panic during shutdown", zap.Any("recover", r))
 		}
-		log.Println("Shutting down HTTP server ...")
+		logger.Info("shutting down HTTP server ...")
 		if err := srv.Shutdown(ctx); err != nil {
-			log.Printf("HTTP server Shutdown: %v", err)
+			logger.Warn("http server shutdown error", zap.Error(err))
 		}
-		log.Println("HTTP server shutdown complete.")
+		logger.Info("HTTP server shutdown complete")
 
-		log.Println("Closing client connections ...")
+		logger.Info("closing client connections ...")
 		hub.Shutdown()
-		log.Println("Client connections closed.")
+		logger.Info("client connections closed")
 
-		log.Println("Closing DB connection ...")
+		logger.Info("closing DB connection ...")
 		db.Close()
-		log.Println("DB connection closed")
+		logger.Info("DB connection closed")
 		cancel()
-		log.Println("Gracefully shutdown!")
+		logger.Info("gracefully shutdown")
 	}()
 
 	// Routes with logging middleware
-	http.Handle("/ws", loggingMiddleware(wsAuthMiddleware(func(w http.ResponseWriter, r *http.Request) {
-		serveWs(hub, w, r)
+	http.Handle("/ws", loggingMiddleware(wsAuthMiddleware(verifier, func(w http.ResponseWriter, r *http.Request) {
+		serveWs(hub, connLimiter, wsMsgLimiter, rlCfg, w, r)
 	})))
-	http.Handle("/api/messages", corsMiddleware(loggingMiddleware(http.HandlerFunc(handleGetMessages))))
+	http.Handle("/api/messages", corsMiddleware(loggingMiddleware(httpRateLimitMiddleware(restLimiter, jwtAuthMiddleware(verifier, http.HandlerFunc(handleGetMessages))))))
+	http.Handle("/api/rooms", corsMiddleware(loggingMiddleware(jwtAuthMiddleware(verifier, handleGetRooms(hub)))))
+	http.Handle("/api/presence", corsMiddleware(loggingMiddleware(jwtAuthMiddleware(verifier, handleGetPresence(hub)))))
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/healthz", handleHealthz)
+	http.HandleFunc("/readyz", handleReadyz(hub))
 
 	// Force IPv4 listener
-	l, err := net.Listen("tcp4", "0.0.0.0:"+config.Port)
+	ln, err := net.Listen("tcp4", "0.0.0.0:"+config.Port)
 	if err != nil {
-		log.Fatal("Failed to bind IPv4:", err)
+		logger.Fatal("failed to bind IPv4", zap.Error(err))
 	}
 
 	// Channel for OS signals
@@ -422,15 +883,14 @@ func main() {
 
 	// Start the server in a goroutine
 	go func() {
-		log.Println("Server started on 0.0.0.0:" + config.Port)
-		log.Println("chat away!")
+		logger.Info("server started", zap.String("addr", "0.0.0.0:"+config.Port))
 		// if err := http.Serve(l, nil); err != nil {
-		if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
-			log.Fatal("Serve error:", err)
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			logger.Fatal("serve error", zap.Error(err))
 		}
 	}()
 
 	// Wait for a shutdown signal
 	<-stop
-	log.Println("Shutting down server...")
+	logger.Info("shutting down server...")
 }
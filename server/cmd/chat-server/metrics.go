@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	messagesSentTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_sent_total",
+		Help: "Total envelopes (chat messages and join/leave/typing events) fanned out to connected clients.",
+	})
+	messagesReceivedTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "chat_messages_received_total",
+		Help: "Total chat messages received from clients over WebSocket.",
+	})
+	activeConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "chat_active_connections",
+		Help: "Number of currently connected WebSocket clients.",
+	})
+	dbQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_db_query_duration_seconds",
+		Help:    "Latency of Postgres queries by operation.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"operation"})
+	httpRequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "chat_http_requests_total",
+		Help: "Total HTTP requests by path, method, and status.",
+	}, []string{"path", "method", "status"})
+	httpRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "chat_http_request_duration_seconds",
+		Help:    "HTTP request latency by path, method, and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"path", "method", "status"})
+)
+
+// observeDBQuery records how long a named DB operation took, for the
+// chat_db_query_duration_seconds histogram.
+func observeDBQuery(operation string, start time.Time) {
+	dbQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
+
+// observeHTTPRequest records the per-status counter/histogram pair used by
+// loggingMiddleware.
+func observeHTTPRequest(path, method string, status int, duration time.Duration) {
+	statusLabel := strconv.Itoa(status)
+	httpRequestsTotal.WithLabelValues(path, method, statusLabel).Inc()
+	httpRequestDuration.WithLabelValues(path, method, statusLabel).Observe(duration.Seconds())
+}
+
+// handleHealthz reports process liveness: if this handler runs at all, the
+// process is alive. It never depends on the DB or hub.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok"))
+}
+
+// handleReadyz checks DB connectivity and hub goroutine liveness before
+// reporting ready, so Kubernetes can hold traffic until both are up.
+func handleReadyz(h *Hub) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), 2*time.Second)
+		defer cancel()
+
+		if err := db.Ping(ctx); err != nil {
+			http.Error(w, "db not ready: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if !h.Alive(ctx) {
+			http.Error(w, "hub not ready", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}
+}
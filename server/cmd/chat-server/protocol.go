@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Envelope is the typed control-frame wrapper for all WebSocket traffic.
+// "chat" carries a Message payload and is the only type persisted to
+// Postgres; "join", "leave", "typing", and "presence" are ephemeral and
+// only ever broadcast to the sender's room.
+type Envelope struct {
+	Type    string          `json:"type"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+const (
+	EnvelopeChat        = "chat"
+	EnvelopeJoin        = "join"
+	EnvelopeLeave       = "leave"
+	EnvelopeTyping      = "typing"
+	EnvelopePresence    = "presence"
+	EnvelopeRateLimited = "rate_limited"
+)
+
+// RateLimitedPayload is sent to a throttled client instead of processing its
+// message.
+type RateLimitedPayload struct {
+	RetryAfterMs int64 `json:"retry_after_ms"`
+}
+
+// PresenceEvent is broadcast on join/leave/typing so other room members can
+// update their roster without polling /api/presence, and is also the shape
+// returned by GET /api/presence.
+type PresenceEvent struct {
+	ClientID string    `json:"client_id"`
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"last_seen"`
+}
+
+// encodeEnvelope marshals payload and wraps it in an Envelope of type typ.
+func encodeEnvelope(typ string, payload any) ([]byte, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(Envelope{Type: typ, Payload: body})
+}
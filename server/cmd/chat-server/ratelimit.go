@@ -0,0 +1,172 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// ipLimiterTTL is how long an IP's token bucket is kept around after its
+// last request before being evicted.
+const ipLimiterTTL = 10 * time.Minute
+
+// wsRateLimitRetryAfter is advertised in the rate_limited control frame;
+// it's a fixed hint rather than a computed one since the token bucket
+// doesn't expose "time until next token" directly.
+const wsRateLimitRetryAfter = time.Second
+
+// RateLimitConfig holds the tunables for the REST and WebSocket rate
+// limiters and the per-IP connection cap, read from env at startup.
+type RateLimitConfig struct {
+	MsgPerSec   float64
+	Burst       int
+	ConnPerIP   int
+	MaxMsgBytes int64
+}
+
+func loadRateLimitConfig() RateLimitConfig {
+	cfg := RateLimitConfig{
+		MsgPerSec:   5,
+		Burst:       10,
+		ConnPerIP:   5,
+		MaxMsgBytes: 4096,
+	}
+	if v := os.Getenv("RATE_MSG_PER_SEC"); v != "" {
+		if parsed, err := strconv.ParseFloat(v, 64); err == nil && parsed > 0 {
+			cfg.MsgPerSec = parsed
+		}
+	}
+	if v := os.Getenv("RATE_BURST"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			cfg.Burst = parsed
+		}
+	}
+	if v := os.Getenv("RATE_CONN_PER_IP"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 {
+			cfg.ConnPerIP = parsed
+		}
+	}
+	if v := os.Getenv("RATE_WS_MAX_BYTES"); v != "" {
+		if parsed, err := strconv.ParseInt(v, 10, 64); err == nil && parsed > 0 {
+			cfg.MaxMsgBytes = parsed
+		}
+	}
+	return cfg
+}
+
+// ipLimiterEntry pairs a token bucket with the last time it was touched, so
+// idle IPs can be evicted instead of accumulating forever.
+type ipLimiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+// IPRateLimiter hands out a *rate.Limiter per client IP and evicts entries
+// idle past ttl on each access, keeping memory bounded under churn.
+type IPRateLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*ipLimiterEntry
+	rps     rate.Limit
+	burst   int
+	ttl     time.Duration
+}
+
+func newIPRateLimiter(rps float64, burst int, ttl time.Duration) *IPRateLimiter {
+	return &IPRateLimiter{
+		entries: make(map[string]*ipLimiterEntry),
+		rps:     rate.Limit(rps),
+		burst:   burst,
+		ttl:     ttl,
+	}
+}
+
+// Allow reports whether ip may proceed, consuming a token if so.
+func (l *IPRateLimiter) Allow(ip string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.evictLocked()
+
+	e, ok := l.entries[ip]
+	if !ok {
+		e = &ipLimiterEntry{limiter: rate.NewLimiter(l.rps, l.burst)}
+		l.entries[ip] = e
+	}
+	e.lastSeen = time.Now()
+	return e.limiter.Allow()
+}
+
+// evictLocked drops limiter state for IPs idle past ttl. Callers must hold mu.
+func (l *IPRateLimiter) evictLocked() {
+	cutoff := time.Now().Add(-l.ttl)
+	for ip, e := range l.entries {
+		if e.lastSeen.Before(cutoff) {
+			delete(l.entries, ip)
+		}
+	}
+}
+
+// ConnLimiter caps concurrent WebSocket connections per IP.
+type ConnLimiter struct {
+	mu     sync.Mutex
+	counts map[string]int
+	max    int
+}
+
+func newConnLimiter(max int) *ConnLimiter {
+	return &ConnLimiter{counts: make(map[string]int), max: max}
+}
+
+// Acquire reserves a connection slot for ip, returning false if ip is
+// already at the per-IP cap.
+func (c *ConnLimiter) Acquire(ip string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip] >= c.max {
+		return false
+	}
+	c.counts[ip]++
+	return true
+}
+
+// Release frees a connection slot for ip.
+func (c *ConnLimiter) Release(ip string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts[ip] <= 1 {
+		delete(c.counts, ip)
+		return
+	}
+	c.counts[ip]--
+}
+
+// httpRateLimitMiddleware returns 429 once the caller's IP exceeds limiter's
+// rate, advertising Retry-After so well-behaved clients back off.
+func httpRateLimitMiddleware(limiter *IPRateLimiter, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := getRealIP(r)
+		if !limiter.Allow(ip) {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sendRateLimited notifies the client it's being throttled via a
+// {"type":"rate_limited"} control frame instead of dropping the message
+// silently.
+func (c *Client) sendRateLimited(retryAfter time.Duration) {
+	data, err := encodeEnvelope(EnvelopeRateLimited, RateLimitedPayload{RetryAfterMs: retryAfter.Milliseconds()})
+	if err != nil {
+		c.logger.Error("encode rate_limited envelope failed", zap.Error(err))
+		return
+	}
+	c.trySend(data)
+}
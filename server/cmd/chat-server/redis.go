@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// nodeID identifies this process instance in relayed Redis payloads so a
+// node can recognize and skip messages it published itself when they come
+// back through the subscription, preventing re-broadcast loops.
+var nodeID = newNodeID()
+
+func newNodeID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%d", host, os.Getpid())
+}
+
+const redisReconnectDelay = 3 * time.Second
+
+// relayEnvelope is what actually goes over the Redis channel: the
+// already-encoded local envelope plus the originating node ID.
+type relayEnvelope struct {
+	NodeID string          `json:"node_id"`
+	Data   json.RawMessage `json:"data"`
+}
+
+func redisChannel(room string) string {
+	return "chat:" + room
+}
+
+// connectRedis dials Redis and verifies connectivity with a ping.
+func connectRedis(redisURL string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	client := redis.NewClient(opts)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// EnableRedis wires h up to publish/subscribe through Redis so multiple
+// server instances behind a load balancer can share a single chat. It
+// starts the subscriber goroutine and returns a cleanup func for shutdown.
+func (h *Hub) EnableRedis(redisURL string, l *zap.Logger) (func(), error) {
+	client, err := connectRedis(redisURL)
+	if err != nil {
+		return nil, err
+	}
+	h.redis = client
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go h.subscribeRedis(ctx, l)
+
+	return func() {
+		cancel()
+		client.Close()
+	}, nil
+}
+
+// publishRedis best-effort publishes a locally-originated message so other
+// instances can fan it out to their own clients. Failures are logged, not
+// fatal, since the local broadcast has already happened.
+func (h *Hub) publishRedis(msg roomMessage, l *zap.Logger) {
+	if h.redis == nil {
+		return
+	}
+	payload, err := json.Marshal(relayEnvelope{NodeID: nodeID, Data: msg.data})
+	if err != nil {
+		l.Error("marshal redis relay envelope failed", zap.Error(err))
+		return
+	}
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		if err := h.redis.Publish(ctx, redisChannel(msg.room), payload).Err(); err != nil {
+			l.Warn("redis publish failed", zap.Error(err), zap.String("room", msg.room))
+		}
+	}()
+}
+
+// subscribeRedis relays messages published by other instances into this
+// instance's local fanout, reconnecting with a fixed backoff if the
+// subscription drops.
+func (h *Hub) subscribeRedis(ctx context.Context, l *zap.Logger) {
+	for {
+		pubsub := h.redis.PSubscribe(ctx, "chat:*")
+		l.Info("subscribed to redis backplane")
+
+		for msg := range pubsub.Channel() {
+			var rel relayEnvelope
+			if err := json.Unmarshal([]byte(msg.Payload), &rel); err != nil {
+				l.Warn("invalid redis relay payload", zap.Error(err))
+				continue
+			}
+			if rel.NodeID == nodeID {
+				continue // this instance published it; already delivered locally
+			}
+			room := strings.TrimPrefix(msg.Channel, "chat:")
+			h.inbound <- roomMessage{room: room, data: rel.Data}
+		}
+		pubsub.Close()
+
+		if ctx.Err() != nil {
+			return
+		}
+		l.Warn("redis subscription closed, reconnecting", zap.Duration("backoff", redisReconnectDelay))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(redisReconnectDelay):
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// tcpProxy sits between a redis client under test and a long-lived miniredis
+// instance so a test can sever the in-flight connection (simulating a
+// dropped subscription) without tearing miniredis itself down.
+type tcpProxy struct {
+	ln     net.Listener
+	target string
+
+	mu    sync.Mutex
+	conns []net.Conn
+}
+
+func newTCPProxy(t *testing.T, target string) *tcpProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("proxy listen: %v", err)
+	}
+	p := &tcpProxy{ln: ln, target: target}
+	go p.serve()
+	t.Cleanup(p.close)
+	return p
+}
+
+func (p *tcpProxy) addr() string { return p.ln.Addr().String() }
+
+func (p *tcpProxy) serve() {
+	for {
+		conn, err := p.ln.Accept()
+		if err != nil {
+			return
+		}
+		p.mu.Lock()
+		p.conns = append(p.conns, conn)
+		p.mu.Unlock()
+		go p.relay(conn)
+	}
+}
+
+func (p *tcpProxy) relay(conn net.Conn) {
+	defer conn.Close()
+	upstream, err := net.Dial("tcp", p.target)
+	if err != nil {
+		return
+	}
+	defer upstream.Close()
+	go io.Copy(upstream, conn)
+	io.Copy(conn, upstream)
+}
+
+// sever disconnects every connection currently proxied, forcing the redis
+// client on the other end to reconnect on its next read/write, without
+// touching the upstream miniredis instance.
+func (p *tcpProxy) sever() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, c := range p.conns {
+		c.Close()
+	}
+	p.conns = nil
+}
+
+func (p *tcpProxy) close() { p.ln.Close() }
+
+// newTestHub wires a Hub up to the given redis address (host:port, no
+// scheme) the same way main() does for REDIS_URL, registering cleanup.
+func newTestHub(t *testing.T, addr string) *Hub {
+	t.Helper()
+	h := newHub()
+	cleanup, err := h.EnableRedis("redis://"+addr, zap.NewNop())
+	if err != nil {
+		t.Fatalf("EnableRedis: %v", err)
+	}
+	t.Cleanup(cleanup)
+	return h
+}
+
+// publishRaw publishes a relay envelope directly against addr, standing in
+// for a message fanned out by another instance (nodeID is caller-supplied
+// rather than this process's own nodeID).
+func publishRaw(t *testing.T, addr, room, nodeID, data string) {
+	t.Helper()
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+
+	payload, err := json.Marshal(relayEnvelope{NodeID: nodeID, Data: json.RawMessage(data)})
+	if err != nil {
+		t.Fatalf("marshal relay envelope: %v", err)
+	}
+	if err := client.Publish(context.Background(), redisChannel(room), payload).Err(); err != nil {
+		t.Fatalf("publish: %v", err)
+	}
+}
+
+func TestRedisBackplane_CrossInstanceFanout(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := newTestHub(t, mr.Addr())
+
+	publishRaw(t, mr.Addr(), "general", "other-node", `{"text":"hi"}`)
+
+	select {
+	case msg := <-h.inbound:
+		if msg.room != "general" {
+			t.Fatalf("room = %q, want %q", msg.room, "general")
+		}
+		if string(msg.data) != `{"text":"hi"}` {
+			t.Fatalf("data = %s, want relayed payload", msg.data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for relayed message on h.inbound")
+	}
+}
+
+func TestRedisBackplane_SuppressesSelfPublished(t *testing.T) {
+	mr := miniredis.RunT(t)
+	h := newTestHub(t, mr.Addr())
+
+	// publishRedis stamps the process-wide nodeID, so a message it sends
+	// should never come back through this same hub's subscription.
+	h.publishRedis(roomMessage{room: "general", data: []byte(`{"text":"self"}`)}, zap.NewNop())
+
+	select {
+	case msg := <-h.inbound:
+		t.Fatalf("self-published message was not suppressed, got %+v", msg)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	// A message published under a different node ID on the same channel
+	// still comes through, proving the channel itself is live.
+	publishRaw(t, mr.Addr(), "general", "other-node", `{"text":"other"}`)
+	select {
+	case <-h.inbound:
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for other-node message on h.inbound")
+	}
+}
+
+func TestRedisBackplane_ReconnectsAfterDroppedSubscription(t *testing.T) {
+	mr := miniredis.RunT(t)
+	proxy := newTCPProxy(t, mr.Addr())
+	h := newTestHub(t, proxy.addr())
+
+	// Give subscribeRedis a chance to establish its initial PSUBSCRIBE
+	// before we sever the connection it's using.
+	time.Sleep(100 * time.Millisecond)
+	proxy.sever()
+
+	// Pub/sub does not buffer for a missing subscriber, so a message sent
+	// while the subscription is down is lost; keep publishing until one
+	// arrives over the re-established subscription.
+	deadline := time.After(redisReconnectDelay + 2*time.Second)
+	retry := time.NewTicker(100 * time.Millisecond)
+	defer retry.Stop()
+	for {
+		publishRaw(t, mr.Addr(), "general", "other-node", `{"text":"after-reconnect"}`)
+		select {
+		case msg := <-h.inbound:
+			if msg.room != "general" {
+				t.Fatalf("room = %q, want %q", msg.room, "general")
+			}
+			return
+		case <-deadline:
+			t.Fatal("timed out waiting for message after reconnecting")
+		case <-retry.C:
+		}
+	}
+}